@@ -0,0 +1,68 @@
+// Copyright 2022-2023 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command client-grpc talks to cmd/demoserver's Eliza service using native
+// gRPC rather than the Connect protocol, to show that the same handler
+// serves both without any code changes. See cmd/client-multi for a version
+// that exercises Connect, gRPC, and gRPC-Web side by side.
+package main
+
+import (
+	"context"
+	"log"
+
+	"github.com/spf13/pflag"
+
+	"connect-examples-go/internal/clienttest"
+)
+
+func main() {
+	log.SetFlags(0)
+	addrArg := pflag.StringP("addr", "a", "localhost:8082", "The Eliza server's host:port.")
+	tlsArg := pflag.Bool("tls", false, "Dial with TLS instead of cleartext h2c.")
+	insecureArg := pflag.Bool("insecure-skip-verify", false, "Skip server certificate verification. Only applies with --tls.")
+	helpArg := pflag.BoolP("help", "h", false, "")
+	pflag.Parse()
+
+	if *helpArg {
+		pflag.PrintDefaults()
+		return
+	}
+
+	opts := clienttest.DialOptions{
+		Addr:               *addrArg,
+		TLS:                *tlsArg,
+		InsecureSkipVerify: *insecureArg,
+	}
+
+	ctx := context.Background()
+	conn, err := clienttest.DialGRPC(ctx, opts)
+	if err != nil {
+		log.Fatalf("dial %s: %v", opts.Addr, err)
+	}
+	defer conn.Close()
+
+	client := clienttest.NewGRPCClient(conn)
+	transcript, err := clienttest.Sequence(ctx, client)
+	if err != nil {
+		log.Fatalf("gRPC call sequence: %v", err)
+	}
+	log.Println("Say:", transcript.Said)
+	for _, sentence := range transcript.Introduce {
+		log.Println("Introduce:", sentence)
+	}
+	for _, sentence := range transcript.Converse {
+		log.Println("Converse:", sentence)
+	}
+}
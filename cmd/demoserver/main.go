@@ -38,6 +38,8 @@ import (
 	"connect-examples-go/internal/eliza"
 	elizav1 "connect-examples-go/internal/gen/connectrpc/eliza/v1"
 	"connect-examples-go/internal/gen/connectrpc/eliza/v1/elizav1connect"
+	"connect-examples-go/internal/health"
+	"connect-examples-go/internal/logging"
 )
 
 type elizaServer struct {
@@ -173,6 +175,13 @@ func main() {
 		return
 	}
 
+	logger := slog.New(
+		slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug}),
+	)
+	elizaServer := NewElizaServer(*streamDelayArg)
+	healthChecker := health.NewDynamicHealthChecker(logger)
+	healthChecker.SetServing(elizav1connect.ElizaServiceName)
+
 	mux := http.NewServeMux()
 	mux.Handle(
 		"/",
@@ -180,18 +189,14 @@ func main() {
 	)
 	compress1KB := connect.WithCompressMinBytes(1024)
 	mux.Handle(elizav1connect.NewElizaServiceHandler(
-		NewElizaServer(*streamDelayArg),
+		elizaServer,
 		compress1KB,
 		connect.WithInterceptors(
-			&RequestLoggingInterceptor{
-				slog.New(
-					slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug}),
-				),
-			},
+			logging.New(logger, logging.WithAllowedHeaders("User-Agent")),
 		),
 	))
 	mux.Handle(grpchealth.NewHandler(
-		grpchealth.NewStaticChecker(elizav1connect.ElizaServiceName),
+		healthChecker,
 		compress1KB,
 	))
 	mux.Handle(grpcreflect.NewHandlerV1(
@@ -217,6 +222,27 @@ func main() {
 		WriteTimeout:      5 * time.Minute,
 		MaxHeaderBytes:    8 * 1024, // 8KiB
 	}
+	probeCtx, stopProbe := context.WithCancel(context.Background())
+	defer stopProbe()
+	go healthChecker.RunSelfProbe(probeCtx, elizav1connect.ElizaServiceName, 15*time.Second, 3,
+		func(ctx context.Context) error {
+			_, err := elizaServer.Say(ctx, connect.NewRequest(&elizav1.SayRequest{Sentence: "ping"}))
+			return err
+		},
+	)
+
+	maintenanceSignals := make(chan os.Signal, 1)
+	signal.Notify(maintenanceSignals, syscall.SIGUSR1)
+	go func() {
+		for range maintenanceSignals {
+			if healthChecker.ToggleMaintenance(elizav1connect.ElizaServiceName) {
+				logger.Info("entered maintenance mode")
+			} else {
+				logger.Info("left maintenance mode")
+			}
+		}
+	}()
+
 	signals := make(chan os.Signal, 1)
 	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
 	go func() {
@@ -232,48 +258,3 @@ func main() {
 		log.Fatalf("HTTP shutdown: %v", err) //nolint:gocritic
 	}
 }
-
-var _ connect.Interceptor = (*RequestLoggingInterceptor)(nil)
-
-type RequestLoggingInterceptor struct {
-	logger *slog.Logger
-}
-
-// WrapStreamingClient implements connect.Interceptor.
-func (i *RequestLoggingInterceptor) WrapStreamingClient(next connect.StreamingClientFunc) connect.StreamingClientFunc {
-	return next
-}
-
-// WrapStreamingHandler implements connect.Interceptor.
-func (i *RequestLoggingInterceptor) WrapStreamingHandler(next connect.StreamingHandlerFunc) connect.StreamingHandlerFunc {
-	return func(ctx context.Context, shc connect.StreamingHandlerConn) error {
-		return next(ctx, &wrappedStreamingHandlerConn{
-			onReceive: func(v any) {
-				i.logger.DebugContext(ctx, "streaming_request", slog.Any("request", v))
-			},
-			StreamingHandlerConn: shc,
-		})
-	}
-}
-
-// WrapUnary implements connect.Interceptor.
-func (i *RequestLoggingInterceptor) WrapUnary(next connect.UnaryFunc) connect.UnaryFunc {
-	return func(ctx context.Context, req connect.AnyRequest) (connect.AnyResponse, error) {
-		i.logger.DebugContext(ctx, "unary_request", slog.Any("request", req.Any()))
-		return next(ctx, req)
-	}
-}
-
-type wrappedStreamingHandlerConn struct {
-	onReceive func(any)
-	connect.StreamingHandlerConn
-}
-
-func (w *wrappedStreamingHandlerConn) Receive(v any) error {
-	err := w.StreamingHandlerConn.Receive(v)
-	if err != nil {
-		return err
-	}
-	w.onReceive(v)
-	return nil
-}
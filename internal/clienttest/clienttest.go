@@ -0,0 +1,282 @@
+// Copyright 2022-2023 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package clienttest wires up Eliza clients for the Connect, gRPC, and
+// gRPC-Web protocols against a shared *http.Client/*grpc.ClientConn dialing
+// configuration, and runs the same Say/Introduce/Converse sequence through
+// any of them. It's shared by cmd/client-grpc, cmd/client-multi, and their
+// tests so all three agree on exactly what "the same call sequence" means.
+package clienttest
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+
+	elizav1grpc "buf.build/gen/go/connectrpc/eliza/grpc/go/connectrpc/eliza/v1/elizav1grpc"
+	elizav1pb "buf.build/gen/go/connectrpc/eliza/protocolbuffers/go/connectrpc/eliza/v1"
+	"connectrpc.com/connect"
+	"golang.org/x/net/http2"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+
+	elizav1 "connect-examples-go/internal/gen/connectrpc/eliza/v1"
+	"connect-examples-go/internal/gen/connectrpc/eliza/v1/elizav1connect"
+)
+
+// ElizaClient is a transport-agnostic view of the ElizaService, implemented
+// once per protocol so cmd/client-multi can drive identical requests
+// through each and compare the results.
+type ElizaClient interface {
+	Say(ctx context.Context, sentence string) (string, error)
+	Introduce(ctx context.Context, name string) ([]string, error)
+	Converse(ctx context.Context, sentences []string) ([]string, error)
+}
+
+// Transcript is the result of running Sequence against an ElizaClient.
+type Transcript struct {
+	Said      string
+	Introduce []string
+	Converse  []string
+}
+
+// Sequence runs the fixed Say/Introduce/Converse call sequence that all of
+// this package's example commands use to exercise a client end to end.
+func Sequence(ctx context.Context, client ElizaClient) (*Transcript, error) {
+	said, err := client.Say(ctx, "Hey")
+	if err != nil {
+		return nil, fmt.Errorf("say: %w", err)
+	}
+	intro, err := client.Introduce(ctx, "John")
+	if err != nil {
+		return nil, fmt.Errorf("introduce: %w", err)
+	}
+	converse, err := client.Converse(ctx, []string{"Tell me about yourself.", "Goodbye"})
+	if err != nil {
+		return nil, fmt.Errorf("converse: %w", err)
+	}
+	return &Transcript{Said: said, Introduce: intro, Converse: converse}, nil
+}
+
+// Diff compares two transcripts and returns a human-readable description of
+// each mismatch, or nil if they're identical. Transcripts are expected to
+// differ only when the server behaves differently across protocols, which
+// would be a bug this harness exists to catch.
+func (t *Transcript) Diff(other *Transcript) []string {
+	var diffs []string
+	if t.Said != other.Said {
+		diffs = append(diffs, fmt.Sprintf("Say: %q != %q", t.Said, other.Said))
+	}
+	if !equalSlices(t.Introduce, other.Introduce) {
+		diffs = append(diffs, fmt.Sprintf("Introduce: %v != %v", t.Introduce, other.Introduce))
+	}
+	if !equalSlices(t.Converse, other.Converse) {
+		diffs = append(diffs, fmt.Sprintf("Converse: %v != %v", t.Converse, other.Converse))
+	}
+	return diffs
+}
+
+func equalSlices(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// DialOptions configures how the example commands reach the Eliza server.
+type DialOptions struct {
+	// Addr is the server's host:port, e.g. "localhost:8082".
+	Addr string
+	// TLS enables TLS when dialing. When false, connections use cleartext
+	// HTTP/2 (h2c), which is what cmd/demoserver listens with by default.
+	TLS bool
+	// InsecureSkipVerify disables server certificate verification. It only
+	// applies when TLS is true, and exists so the examples can be pointed at
+	// a demoserver using a self-signed certificate.
+	InsecureSkipVerify bool
+}
+
+// NewConnectHTTPClient builds an *http.Client suitable for use with
+// elizav1connect.NewElizaServiceClient, dialing cleartext h2c or TLS per
+// opts.
+func NewConnectHTTPClient(opts DialOptions) *http.Client {
+	if !opts.TLS {
+		return &http.Client{
+			Transport: &http2.Transport{
+				AllowHTTP: true,
+				DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+					return (&net.Dialer{}).DialContext(ctx, network, addr)
+				},
+			},
+		}
+	}
+	return &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: opts.InsecureSkipVerify}, //nolint:gosec
+		},
+	}
+}
+
+// NewConnectClient wraps a Connect-generated ElizaServiceClient, configured
+// with clientOpts (e.g. connect.WithGRPC() or connect.WithGRPCWeb()), as an
+// ElizaClient.
+func NewConnectClient(httpClient connect.HTTPClient, baseURL string, clientOpts ...connect.ClientOption) ElizaClient {
+	return &connectClient{elizav1connect.NewElizaServiceClient(httpClient, baseURL, clientOpts...)}
+}
+
+type connectClient struct {
+	client elizav1connect.ElizaServiceClient
+}
+
+func (c *connectClient) Say(ctx context.Context, sentence string) (string, error) {
+	res, err := c.client.Say(ctx, connect.NewRequest(&elizav1.SayRequest{Sentence: sentence}))
+	if err != nil {
+		return "", err
+	}
+	return res.Msg.Sentence, nil
+}
+
+func (c *connectClient) Introduce(ctx context.Context, name string) ([]string, error) {
+	stream, err := c.client.Introduce(ctx, connect.NewRequest(&elizav1.IntroduceRequest{Name: name}))
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+	var sentences []string
+	for stream.Receive() {
+		sentences = append(sentences, stream.Msg().Sentence)
+	}
+	return sentences, stream.Err()
+}
+
+func (c *connectClient) Converse(ctx context.Context, sentences []string) ([]string, error) {
+	stream := c.client.Converse(ctx)
+	return converseOverStream(sentences,
+		func(s string) error { return stream.Send(&elizav1.ConverseRequest{Sentence: s}) },
+		func() (string, error) {
+			res, err := stream.Receive()
+			if err != nil {
+				return "", err
+			}
+			return res.Sentence, nil
+		},
+		stream.CloseRequest,
+		stream.CloseResponse,
+	)
+}
+
+// DialGRPC opens a *grpc.ClientConn to the Eliza server per opts, using h2c
+// when TLS isn't requested so it can reach the same cleartext listener the
+// Connect and gRPC-Web clients talk to.
+func DialGRPC(ctx context.Context, opts DialOptions) (*grpc.ClientConn, error) {
+	creds := insecure.NewCredentials()
+	if opts.TLS {
+		creds = credentials.NewTLS(&tls.Config{InsecureSkipVerify: opts.InsecureSkipVerify}) //nolint:gosec
+	}
+	return grpc.NewClient(opts.Addr, grpc.WithTransportCredentials(creds))
+}
+
+// NewGRPCClient wraps a native gRPC ElizaServiceClient as an ElizaClient.
+func NewGRPCClient(conn grpc.ClientConnInterface) ElizaClient {
+	return &grpcClient{elizav1grpc.NewElizaServiceClient(conn)}
+}
+
+type grpcClient struct {
+	client elizav1grpc.ElizaServiceClient
+}
+
+func (c *grpcClient) Say(ctx context.Context, sentence string) (string, error) {
+	res, err := c.client.Say(ctx, &elizav1pb.SayRequest{Sentence: sentence})
+	if err != nil {
+		return "", err
+	}
+	return res.GetSentence(), nil
+}
+
+func (c *grpcClient) Introduce(ctx context.Context, name string) ([]string, error) {
+	stream, err := c.client.Introduce(ctx, &elizav1pb.IntroduceRequest{Name: name})
+	if err != nil {
+		return nil, err
+	}
+	var sentences []string
+	for {
+		res, err := stream.Recv()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return sentences, nil
+			}
+			return sentences, err
+		}
+		sentences = append(sentences, res.GetSentence())
+	}
+}
+
+func (c *grpcClient) Converse(ctx context.Context, sentences []string) ([]string, error) {
+	stream, err := c.client.Converse(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return converseOverStream(sentences,
+		func(s string) error { return stream.Send(&elizav1pb.ConverseRequest{Sentence: s}) },
+		func() (string, error) {
+			res, err := stream.Recv()
+			if err != nil {
+				return "", err
+			}
+			return res.GetSentence(), nil
+		},
+		stream.CloseSend,
+		func() error { return nil },
+	)
+}
+
+// converseOverStream drives a bidirectional Converse exchange the same way
+// regardless of which generated stream type is underneath: send every
+// sentence, close the send side, then drain responses until the stream
+// ends.
+func converseOverStream(sentences []string, send func(string) error, recv func() (string, error), closeSend func() error, closeRecv func() error) ([]string, error) {
+	for _, sentence := range sentences {
+		if err := send(sentence); err != nil {
+			return nil, fmt.Errorf("send: %w", err)
+		}
+	}
+	if err := closeSend(); err != nil {
+		return nil, fmt.Errorf("close send: %w", err)
+	}
+	var replies []string
+	for {
+		reply, err := recv()
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				return nil, fmt.Errorf("recv: %w", err)
+			}
+			break
+		}
+		replies = append(replies, reply)
+	}
+	if err := closeRecv(); err != nil {
+		return nil, fmt.Errorf("close recv: %w", err)
+	}
+	return replies, nil
+}
@@ -0,0 +1,144 @@
+// Copyright 2022-2023 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package clienttest
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+)
+
+// fakeClient is a stand-in ElizaClient so Sequence and Diff can be tested
+// without dialing a real server.
+type fakeClient struct {
+	said      string
+	introduce []string
+	converse  []string
+	err       error
+}
+
+func (f *fakeClient) Say(context.Context, string) (string, error) { return f.said, f.err }
+
+func (f *fakeClient) Introduce(context.Context, string) ([]string, error) {
+	return f.introduce, f.err
+}
+
+func (f *fakeClient) Converse(context.Context, []string) ([]string, error) {
+	return f.converse, f.err
+}
+
+func TestSequence(t *testing.T) {
+	t.Parallel()
+	client := &fakeClient{
+		said:      "Tell me more.",
+		introduce: []string{"Hello, John", "How can I help?"},
+		converse:  []string{"Go on.", "Goodbye."},
+	}
+	transcript, err := Sequence(context.Background(), client)
+	if err != nil {
+		t.Fatalf("Sequence: %v", err)
+	}
+	if transcript.Said != client.said {
+		t.Errorf("Said = %q, want %q", transcript.Said, client.said)
+	}
+	if len(transcript.Diff(&Transcript{Said: client.said, Introduce: client.introduce, Converse: client.converse})) != 0 {
+		t.Errorf("transcript unexpectedly differs from its own values")
+	}
+}
+
+func TestSequence_PropagatesErrors(t *testing.T) {
+	t.Parallel()
+	client := &fakeClient{err: errors.New("unavailable")}
+	if _, err := Sequence(context.Background(), client); err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+// converseOverStream is used by every protocol's Converse implementation, so
+// its recv-draining logic is tested directly against fake send/recv
+// closures rather than through a real client.
+func TestConverseOverStream_StopsCleanlyAtEOF(t *testing.T) {
+	t.Parallel()
+	replies := []string{"one", "two"}
+	recv := func() (string, error) {
+		if len(replies) == 0 {
+			return "", io.EOF
+		}
+		reply := replies[0]
+		replies = replies[1:]
+		return reply, nil
+	}
+	got, err := converseOverStream(
+		[]string{"hi"},
+		func(string) error { return nil },
+		recv,
+		func() error { return nil },
+		func() error { return nil },
+	)
+	if err != nil {
+		t.Fatalf("converseOverStream: %v", err)
+	}
+	if want := []string{"one", "two"}; !equalSlices(got, want) {
+		t.Fatalf("replies = %v, want %v", got, want)
+	}
+}
+
+func TestConverseOverStream_PropagatesRecvError(t *testing.T) {
+	t.Parallel()
+	wantErr := errors.New("connection reset")
+	recv := func() (string, error) { return "", wantErr }
+	_, err := converseOverStream(
+		[]string{"hi"},
+		func(string) error { return nil },
+		recv,
+		func() error { return nil },
+		func() error { return nil },
+	)
+	if !errors.Is(err, wantErr) {
+		t.Fatalf("converseOverStream error = %v, want wrapping %v", err, wantErr)
+	}
+}
+
+func TestConverseOverStream_PropagatesSendError(t *testing.T) {
+	t.Parallel()
+	wantErr := errors.New("broken pipe")
+	_, err := converseOverStream(
+		[]string{"hi"},
+		func(string) error { return wantErr },
+		func() (string, error) { return "", io.EOF },
+		func() error { return nil },
+		func() error { return nil },
+	)
+	if !errors.Is(err, wantErr) {
+		t.Fatalf("converseOverStream error = %v, want wrapping %v", err, wantErr)
+	}
+}
+
+func TestTranscriptDiff(t *testing.T) {
+	t.Parallel()
+	a := &Transcript{Said: "hi", Introduce: []string{"a", "b"}, Converse: []string{"c"}}
+	b := &Transcript{Said: "hi", Introduce: []string{"a", "b"}, Converse: []string{"c"}}
+	if diffs := a.Diff(b); len(diffs) != 0 {
+		t.Errorf("identical transcripts should not differ, got %v", diffs)
+	}
+
+	b.Said = "bye"
+	b.Converse = []string{"different"}
+	diffs := a.Diff(b)
+	if len(diffs) != 2 {
+		t.Fatalf("expected 2 diffs, got %v", diffs)
+	}
+}
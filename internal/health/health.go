@@ -0,0 +1,192 @@
+// Copyright 2022-2023 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package health implements a grpchealth.Checker whose status is driven by
+// real signals (a periodic self-probe, a maintenance-mode toggle) instead of
+// always reporting SERVING like grpchealth.NewStaticChecker does.
+package health
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"connectrpc.com/grpchealth"
+)
+
+// DynamicHealthChecker is a grpchealth.Checker (and grpchealth.Watcher) that
+// tracks a status per service name and notifies anyone watching whenever it
+// changes. The zero value is not usable; construct one with
+// NewDynamicHealthChecker.
+type DynamicHealthChecker struct {
+	logger *slog.Logger
+
+	statuses sync.Map // map[string]grpchealth.Status
+
+	mu       sync.Mutex
+	nextID   uint64
+	watchers map[string]map[uint64]func()
+}
+
+var (
+	_ grpchealth.Checker = (*DynamicHealthChecker)(nil)
+	_ grpchealth.Watcher = (*DynamicHealthChecker)(nil)
+)
+
+// NewDynamicHealthChecker returns a checker that reports StatusUnknown for
+// any service until Set(Not)Serving is called for it. Status transitions are
+// logged to logger.
+func NewDynamicHealthChecker(logger *slog.Logger) *DynamicHealthChecker {
+	return &DynamicHealthChecker{
+		logger:   logger,
+		watchers: make(map[string]map[uint64]func()),
+	}
+}
+
+// SetServing marks service as healthy.
+func (c *DynamicHealthChecker) SetServing(service string) {
+	c.setStatus(service, grpchealth.StatusServing)
+}
+
+// SetNotServing marks service as unhealthy.
+func (c *DynamicHealthChecker) SetNotServing(service string) {
+	c.setStatus(service, grpchealth.StatusNotServing)
+}
+
+// SetUnknown resets service to StatusUnknown, as if it had never been set.
+func (c *DynamicHealthChecker) SetUnknown(service string) {
+	c.setStatus(service, grpchealth.StatusUnknown)
+}
+
+// ToggleMaintenance flips service between StatusNotServing and
+// StatusServing, and reports which state it entered. It's meant to back a
+// SIGUSR1-style maintenance switch: the first signal takes the service out
+// of rotation, the next puts it back.
+func (c *DynamicHealthChecker) ToggleMaintenance(service string) (inMaintenance bool) {
+	if c.status(service) == grpchealth.StatusNotServing {
+		c.SetServing(service)
+		return false
+	}
+	c.SetNotServing(service)
+	return true
+}
+
+func (c *DynamicHealthChecker) status(service string) grpchealth.Status {
+	v, ok := c.statuses.Load(service)
+	if !ok {
+		return grpchealth.StatusUnknown
+	}
+	return v.(grpchealth.Status)
+}
+
+func (c *DynamicHealthChecker) setStatus(service string, status grpchealth.Status) {
+	previous, _ := c.statuses.Swap(service, status)
+	if prev, ok := previous.(grpchealth.Status); ok && prev == status {
+		return
+	}
+	c.logger.Info("health status changed",
+		slog.String("service", service),
+		slog.String("status", status.String()),
+	)
+	c.broadcast(service)
+}
+
+// Check implements grpchealth.Checker.
+func (c *DynamicHealthChecker) Check(_ context.Context, req *grpchealth.CheckRequest) (*grpchealth.CheckResponse, error) {
+	return &grpchealth.CheckResponse{Status: c.status(req.Service)}, nil
+}
+
+// Watch implements grpchealth.Watcher. The checker calls onChange whenever
+// the status for req.Service changes, and grpchealth re-invokes Check to
+// learn the new value; Watch itself only manages the subscription. The returned
+// stop func deregisters onChange and must be safe to call more than once.
+func (c *DynamicHealthChecker) Watch(_ context.Context, req *grpchealth.CheckRequest, onChange func()) (stop func(), err error) {
+	id := c.subscribe(req.Service, onChange)
+	var stopped sync.Once
+	return func() {
+		stopped.Do(func() { c.unsubscribe(req.Service, id) })
+	}, nil
+}
+
+func (c *DynamicHealthChecker) subscribe(service string, onChange func()) uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.nextID++
+	id := c.nextID
+	if c.watchers[service] == nil {
+		c.watchers[service] = make(map[uint64]func())
+	}
+	c.watchers[service][id] = onChange
+	return id
+}
+
+func (c *DynamicHealthChecker) unsubscribe(service string, id uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.watchers[service], id)
+}
+
+func (c *DynamicHealthChecker) broadcast(service string) {
+	c.mu.Lock()
+	onChanges := make([]func(), 0, len(c.watchers[service]))
+	for _, onChange := range c.watchers[service] {
+		onChanges = append(onChanges, onChange)
+	}
+	c.mu.Unlock()
+	for _, onChange := range onChanges {
+		onChange()
+	}
+}
+
+// RunSelfProbe periodically calls probe and flips service to
+// StatusNotServing after failureThreshold consecutive failures, or back to
+// StatusServing on the next success after such a flip. Other successful
+// probes leave the status alone, so a ToggleMaintenance is not undone. It
+// blocks until ctx is done, so callers should run it in its own goroutine.
+func (c *DynamicHealthChecker) RunSelfProbe(ctx context.Context, service string, interval time.Duration, failureThreshold int, probe func(context.Context) error) {
+	if failureThreshold < 1 {
+		failureThreshold = 1
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var failures int
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			probeCtx, cancel := context.WithTimeout(ctx, interval)
+			err := probe(probeCtx)
+			cancel()
+			if err != nil {
+				failures++
+				c.logger.Warn("self-probe failed",
+					slog.String("service", service),
+					slog.Int("consecutive_failures", failures),
+					slog.Any("error", err),
+				)
+				if failures >= failureThreshold {
+					c.SetNotServing(service)
+				}
+				continue
+			}
+			if failures >= failureThreshold {
+				c.SetServing(service)
+			}
+			failures = 0
+		}
+	}
+}
@@ -0,0 +1,210 @@
+// Copyright 2022-2023 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package health
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"connectrpc.com/connect"
+	"connectrpc.com/grpchealth"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func newTestChecker() *DynamicHealthChecker {
+	return NewDynamicHealthChecker(slog.New(slog.NewTextHandler(io.Discard, nil)))
+}
+
+func mustCheck(t *testing.T, c *DynamicHealthChecker, service string) grpchealth.Status {
+	t.Helper()
+	res, err := c.Check(context.Background(), &grpchealth.CheckRequest{Service: service})
+	if err != nil {
+		t.Fatalf("Check: %v", err)
+	}
+	return res.Status
+}
+
+func TestCheck_DefaultsToUnknown(t *testing.T) {
+	t.Parallel()
+	c := newTestChecker()
+	if got := mustCheck(t, c, "svc"); got != grpchealth.StatusUnknown {
+		t.Fatalf("status = %v, want StatusUnknown", got)
+	}
+}
+
+func TestSetServingAndNotServing(t *testing.T) {
+	t.Parallel()
+	c := newTestChecker()
+	c.SetServing("svc")
+	if got := mustCheck(t, c, "svc"); got != grpchealth.StatusServing {
+		t.Fatalf("status = %v, want StatusServing", got)
+	}
+	c.SetNotServing("svc")
+	if got := mustCheck(t, c, "svc"); got != grpchealth.StatusNotServing {
+		t.Fatalf("status = %v, want StatusNotServing", got)
+	}
+}
+
+func TestToggleMaintenance(t *testing.T) {
+	t.Parallel()
+	c := newTestChecker()
+	c.SetServing("svc")
+
+	if inMaintenance := c.ToggleMaintenance("svc"); !inMaintenance {
+		t.Fatal("expected first toggle to enter maintenance")
+	}
+	if got := mustCheck(t, c, "svc"); got != grpchealth.StatusNotServing {
+		t.Fatalf("status = %v, want StatusNotServing", got)
+	}
+
+	if inMaintenance := c.ToggleMaintenance("svc"); inMaintenance {
+		t.Fatal("expected second toggle to leave maintenance")
+	}
+	if got := mustCheck(t, c, "svc"); got != grpchealth.StatusServing {
+		t.Fatalf("status = %v, want StatusServing", got)
+	}
+}
+
+func TestRunSelfProbe_FlipsAfterThreshold(t *testing.T) {
+	t.Parallel()
+	c := newTestChecker()
+	c.SetServing("svc")
+
+	var failing atomic.Bool
+	failing.Store(true)
+	probe := func(context.Context) error {
+		if failing.Load() {
+			return errors.New("dependency unavailable")
+		}
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go c.RunSelfProbe(ctx, "svc", 5*time.Millisecond, 2, probe)
+
+	waitForStatus(t, c, "svc", grpchealth.StatusNotServing)
+
+	failing.Store(false)
+	waitForStatus(t, c, "svc", grpchealth.StatusServing)
+}
+
+func TestWatch_NotifiesOnChange(t *testing.T) {
+	t.Parallel()
+	c := newTestChecker()
+	c.SetServing("svc")
+
+	notified := make(chan struct{}, 1)
+	stop, err := c.Watch(context.Background(), &grpchealth.CheckRequest{Service: "svc"}, func() {
+		select {
+		case notified <- struct{}{}:
+		default:
+		}
+	})
+	if err != nil {
+		t.Fatalf("Watch: %v", err)
+	}
+	defer stop()
+
+	c.SetNotServing("svc")
+	select {
+	case <-notified:
+	case <-time.After(time.Second):
+		t.Fatal("onChange was never called after SetNotServing")
+	}
+}
+
+func TestWatch_StopDeregisters(t *testing.T) {
+	t.Parallel()
+	c := newTestChecker()
+	c.SetServing("svc")
+
+	var calls atomic.Int32
+	stop, err := c.Watch(context.Background(), &grpchealth.CheckRequest{Service: "svc"}, func() {
+		calls.Add(1)
+	})
+	if err != nil {
+		t.Fatalf("Watch: %v", err)
+	}
+	stop()
+	stop() // must be safe to call more than once
+
+	c.SetNotServing("svc")
+	time.Sleep(10 * time.Millisecond)
+	if got := calls.Load(); got != 0 {
+		t.Fatalf("onChange called %d times after stop, want 0", got)
+	}
+}
+
+// TestWatch_PushesUpdatesOverHTTP drives the real gRPC Health Watch RPC,
+// served by grpchealth.NewHandler, end to end: it mutates status on the
+// DynamicHealthChecker and confirms a connected Watch stream observes each
+// transition.
+func TestWatch_PushesUpdatesOverHTTP(t *testing.T) {
+	t.Parallel()
+	c := newTestChecker()
+	c.SetServing("svc")
+
+	mux := http.NewServeMux()
+	mux.Handle(grpchealth.NewHandler(c))
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	client := connect.NewClient[healthpb.HealthCheckRequest, healthpb.HealthCheckResponse](
+		srv.Client(),
+		srv.URL+"/grpc.health.v1.Health/Watch",
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream, err := client.CallServerStream(ctx, connect.NewRequest(&healthpb.HealthCheckRequest{Service: "svc"}))
+	if err != nil {
+		t.Fatalf("Watch stream: %v", err)
+	}
+	defer stream.Close()
+
+	if !stream.Receive() {
+		t.Fatalf("first receive: %v", stream.Err())
+	}
+	if got := stream.Msg().Status; got != healthpb.HealthCheckResponse_SERVING {
+		t.Fatalf("initial status = %v, want SERVING", got)
+	}
+
+	c.SetNotServing("svc")
+	if !stream.Receive() {
+		t.Fatalf("second receive: %v", stream.Err())
+	}
+	if got := stream.Msg().Status; got != healthpb.HealthCheckResponse_NOT_SERVING {
+		t.Fatalf("status after SetNotServing = %v, want NOT_SERVING", got)
+	}
+}
+
+func waitForStatus(t *testing.T, c *DynamicHealthChecker, service string, want grpchealth.Status) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if mustCheck(t, c, service) == want {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("status never became %v", want)
+}
@@ -0,0 +1,297 @@
+// Copyright 2022-2023 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package logging provides a connect.Interceptor that logs unary and
+// streaming RPCs on both the client and server side: procedure, peer,
+// protocol, selected headers, message counts, duration, and terminal status.
+package logging
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"connectrpc.com/connect"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// defaultRedactedHeaders are redacted unless WithRedactedHeaders replaces
+// them, even if also named in an allow-list passed to WithAllowedHeaders.
+var defaultRedactedHeaders = []string{"Authorization", "Cookie", "Set-Cookie"}
+
+// Option configures a RequestLoggingInterceptor constructed with New.
+type Option func(*RequestLoggingInterceptor)
+
+// WithAllowedHeaders sets the request/response headers that are logged.
+// Headers not named here are omitted entirely. The default is none.
+func WithAllowedHeaders(headers ...string) Option {
+	return func(i *RequestLoggingInterceptor) { i.allowedHeaders = headers }
+}
+
+// WithRedactedHeaders replaces the default redact list (Authorization,
+// Cookie, Set-Cookie) with headers. A header in both the allow-list and the
+// redact list is logged with its value replaced by "REDACTED".
+func WithRedactedHeaders(headers ...string) Option {
+	return func(i *RequestLoggingInterceptor) { i.redactedHeaders = headers }
+}
+
+// WithSampler restricts logging to RPCs for which sample returns true. It's
+// meant for high-QPS services where logging every call is too expensive.
+// The default logs every call.
+func WithSampler(sample func(spec connect.Spec) bool) Option {
+	return func(i *RequestLoggingInterceptor) { i.sampler = sample }
+}
+
+// WithPayloadLogging enables logging a proto-JSON rendering of the request
+// and response messages of unary calls, truncated to max bytes. Messages on
+// streams are counted but not rendered. The default, zero, disables payload
+// logging.
+func WithPayloadLogging(max int) Option {
+	return func(i *RequestLoggingInterceptor) { i.payloadMax = max }
+}
+
+// RequestLoggingInterceptor is a connect.Interceptor that logs unary calls
+// and streams on both the client and server side. Construct one with New.
+type RequestLoggingInterceptor struct {
+	logger          *slog.Logger
+	allowedHeaders  []string
+	redactedHeaders []string
+	sampler         func(spec connect.Spec) bool
+	payloadMax      int
+}
+
+var _ connect.Interceptor = (*RequestLoggingInterceptor)(nil)
+
+// New returns a RequestLoggingInterceptor that logs through logger.
+func New(logger *slog.Logger, opts ...Option) *RequestLoggingInterceptor {
+	i := &RequestLoggingInterceptor{
+		logger:          logger,
+		redactedHeaders: defaultRedactedHeaders,
+	}
+	for _, opt := range opts {
+		opt(i)
+	}
+	return i
+}
+
+// WrapUnary implements connect.Interceptor.
+func (i *RequestLoggingInterceptor) WrapUnary(next connect.UnaryFunc) connect.UnaryFunc {
+	return func(ctx context.Context, req connect.AnyRequest) (connect.AnyResponse, error) {
+		spec := req.Spec()
+		if i.sampler != nil && !i.sampler(spec) {
+			return next(ctx, req)
+		}
+		start := time.Now()
+		attrs := i.baseAttrs(spec, req.Peer(), req.Header())
+		if i.payloadMax > 0 {
+			attrs = append(attrs, slog.String("request_payload", i.renderPayload(req.Any())))
+		}
+		i.logger.LogAttrs(ctx, slog.LevelInfo, "rpc_started", attrs...)
+
+		res, err := next(ctx, req)
+
+		attrs = append(attrs, slog.Duration("duration", time.Since(start)), slog.String("code", connect.CodeOf(err).String()))
+		if i.payloadMax > 0 && res != nil {
+			attrs = append(attrs, slog.String("response_payload", i.renderPayload(res.Any())))
+		}
+		level := slog.LevelInfo
+		if err != nil {
+			attrs = append(attrs, slog.Any("error", err))
+			level = slog.LevelError
+		}
+		i.logger.LogAttrs(ctx, level, "rpc_finished", attrs...)
+		return res, err
+	}
+}
+
+// WrapStreamingClient implements connect.Interceptor.
+func (i *RequestLoggingInterceptor) WrapStreamingClient(next connect.StreamingClientFunc) connect.StreamingClientFunc {
+	return func(ctx context.Context, spec connect.Spec) connect.StreamingClientConn {
+		conn := next(ctx, spec)
+		if i.sampler != nil && !i.sampler(spec) {
+			return conn
+		}
+		i.logger.LogAttrs(ctx, slog.LevelInfo, "stream_started", i.baseAttrs(spec, conn.Peer(), conn.RequestHeader())...)
+		return &loggingStreamingClientConn{
+			StreamingClientConn: conn,
+			interceptor:         i,
+			ctx:                 ctx,
+			start:               time.Now(),
+		}
+	}
+}
+
+// WrapStreamingHandler implements connect.Interceptor.
+func (i *RequestLoggingInterceptor) WrapStreamingHandler(next connect.StreamingHandlerFunc) connect.StreamingHandlerFunc {
+	return func(ctx context.Context, conn connect.StreamingHandlerConn) error {
+		spec := conn.Spec()
+		if i.sampler != nil && !i.sampler(spec) {
+			return next(ctx, conn)
+		}
+		start := time.Now()
+		attrs := i.baseAttrs(spec, conn.Peer(), conn.RequestHeader())
+		i.logger.LogAttrs(ctx, slog.LevelInfo, "stream_started", attrs...)
+
+		wrapped := &loggingStreamingHandlerConn{StreamingHandlerConn: conn}
+		err := next(ctx, wrapped)
+
+		attrs = append(attrs,
+			slog.Duration("duration", time.Since(start)),
+			slog.Int64("messages_received", wrapped.received.Load()),
+			slog.Int64("messages_sent", wrapped.sent.Load()),
+			slog.String("code", connect.CodeOf(err).String()),
+		)
+		level := slog.LevelInfo
+		if err != nil {
+			attrs = append(attrs, slog.Any("error", err))
+			level = slog.LevelError
+		}
+		i.logger.LogAttrs(ctx, level, "stream_finished", attrs...)
+		return err
+	}
+}
+
+// baseAttrs builds the attributes common to every log line: procedure,
+// protocol, peer address, and any allow-listed headers (redacted as
+// configured).
+func (i *RequestLoggingInterceptor) baseAttrs(spec connect.Spec, peer connect.Peer, header http.Header) []slog.Attr {
+	attrs := []slog.Attr{
+		slog.String("procedure", spec.Procedure),
+		slog.String("protocol", peer.Protocol),
+		slog.String("peer", peer.Addr),
+	}
+	for _, name := range i.allowedHeaders {
+		value := header.Get(name)
+		if value == "" {
+			continue
+		}
+		if i.isRedacted(name) {
+			value = "REDACTED"
+		}
+		attrs = append(attrs, slog.String("header."+strings.ToLower(name), value))
+	}
+	return attrs
+}
+
+func (i *RequestLoggingInterceptor) isRedacted(header string) bool {
+	for _, redacted := range i.redactedHeaders {
+		if strings.EqualFold(redacted, header) {
+			return true
+		}
+	}
+	return false
+}
+
+// renderPayload renders msg as proto-JSON, truncated to i.payloadMax bytes.
+// It returns an empty string for anything that isn't a proto.Message.
+func (i *RequestLoggingInterceptor) renderPayload(msg any) string {
+	protoMsg, ok := msg.(proto.Message)
+	if !ok {
+		return ""
+	}
+	data, err := protojson.Marshal(protoMsg)
+	if err != nil {
+		return ""
+	}
+	if len(data) > i.payloadMax {
+		return string(data[:i.payloadMax]) + "..."
+	}
+	return string(data)
+}
+
+// loggingStreamingHandlerConn counts messages sent and received on the
+// server side of a stream so WrapStreamingHandler can log totals once the
+// handler returns.
+type loggingStreamingHandlerConn struct {
+	connect.StreamingHandlerConn
+	received, sent atomic.Int64
+}
+
+func (w *loggingStreamingHandlerConn) Receive(msg any) error {
+	err := w.StreamingHandlerConn.Receive(msg)
+	if err == nil {
+		w.received.Add(1)
+	}
+	return err
+}
+
+func (w *loggingStreamingHandlerConn) Send(msg any) error {
+	err := w.StreamingHandlerConn.Send(msg)
+	if err == nil {
+		w.sent.Add(1)
+	}
+	return err
+}
+
+// loggingStreamingClientConn mirrors loggingStreamingHandlerConn for the
+// client side, where the stream's end is signaled by CloseResponse (or a
+// terminal error from Receive) rather than by the wrapped function
+// returning.
+type loggingStreamingClientConn struct {
+	connect.StreamingClientConn
+	interceptor    *RequestLoggingInterceptor
+	ctx            context.Context
+	start          time.Time
+	received, sent atomic.Int64
+	logged         atomic.Bool
+}
+
+func (w *loggingStreamingClientConn) Send(msg any) error {
+	err := w.StreamingClientConn.Send(msg)
+	if err == nil {
+		w.sent.Add(1)
+	}
+	return err
+}
+
+func (w *loggingStreamingClientConn) Receive(msg any) error {
+	err := w.StreamingClientConn.Receive(msg)
+	if err == nil {
+		w.received.Add(1)
+	} else if !errors.Is(err, io.EOF) {
+		w.logEnd(err)
+	}
+	return err
+}
+
+func (w *loggingStreamingClientConn) CloseResponse() error {
+	err := w.StreamingClientConn.CloseResponse()
+	w.logEnd(err)
+	return err
+}
+
+func (w *loggingStreamingClientConn) logEnd(err error) {
+	if !w.logged.CompareAndSwap(false, true) {
+		return
+	}
+	attrs := w.interceptor.baseAttrs(w.Spec(), w.Peer(), w.ResponseHeader())
+	attrs = append(attrs,
+		slog.Duration("duration", time.Since(w.start)),
+		slog.Int64("messages_sent", w.sent.Load()),
+		slog.Int64("messages_received", w.received.Load()),
+		slog.String("code", connect.CodeOf(err).String()),
+	)
+	level := slog.LevelInfo
+	if err != nil {
+		attrs = append(attrs, slog.Any("error", err))
+		level = slog.LevelError
+	}
+	w.interceptor.logger.LogAttrs(w.ctx, level, "stream_finished", attrs...)
+}
@@ -0,0 +1,400 @@
+// Copyright 2022-2023 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"testing"
+
+	"connectrpc.com/connect"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func newTestLogger(buf *bytes.Buffer) *slog.Logger {
+	return slog.New(slog.NewJSONHandler(buf, nil))
+}
+
+// logLines parses each line of a slog JSON handler's output into a map.
+func logLines(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var lines []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var parsed map[string]any
+		if err := json.Unmarshal([]byte(line), &parsed); err != nil {
+			t.Fatalf("parse log line %q: %v", line, err)
+		}
+		lines = append(lines, parsed)
+	}
+	return lines
+}
+
+func newTestSpec(streamType connect.StreamType) connect.Spec {
+	return connect.Spec{StreamType: streamType, Procedure: "/test.Service/Method"}
+}
+
+type fakeUnaryConn struct {
+	connect.AnyRequest
+	peer   connect.Peer
+	header http.Header
+	msg    any
+}
+
+func (f *fakeUnaryConn) Peer() connect.Peer  { return f.peer }
+func (f *fakeUnaryConn) Header() http.Header { return f.header }
+func (f *fakeUnaryConn) Any() any            { return f.msg }
+func (f *fakeUnaryConn) Spec() connect.Spec  { return newTestSpec(connect.StreamTypeUnary) }
+
+func TestWrapUnary(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		handler connect.UnaryFunc
+		wantErr bool
+	}{
+		{
+			name: "success",
+			handler: func(_ context.Context, req connect.AnyRequest) (connect.AnyResponse, error) {
+				return connect.NewResponse(&wrapperspb.StringValue{Value: "ok"}), nil
+			},
+		},
+		{
+			name: "failure",
+			handler: func(_ context.Context, req connect.AnyRequest) (connect.AnyResponse, error) {
+				return nil, connect.NewError(connect.CodeUnavailable, errors.New("down"))
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			var buf bytes.Buffer
+			interceptor := New(newTestLogger(&buf), WithAllowedHeaders("X-Test"))
+
+			req := &fakeUnaryConn{
+				peer:   connect.Peer{Addr: "127.0.0.1:1234", Protocol: connect.ProtocolConnect},
+				header: http.Header{"X-Test": []string{"hello"}},
+				msg:    &wrapperspb.StringValue{Value: "hi"},
+			}
+			_, err := interceptor.WrapUnary(tt.handler)(context.Background(), req)
+			if tt.wantErr != (err != nil) {
+				t.Fatalf("err = %v, wantErr = %v", err, tt.wantErr)
+			}
+
+			lines := logLines(t, &buf)
+			if len(lines) != 2 {
+				t.Fatalf("got %d log lines, want 2", len(lines))
+			}
+			finished := lines[1]
+			if finished["header.x-test"] != "hello" {
+				t.Errorf("header.x-test = %v, want %q", finished["header.x-test"], "hello")
+			}
+			if tt.wantErr && finished["level"] != "ERROR" {
+				t.Errorf("level = %v, want ERROR", finished["level"])
+			}
+		})
+	}
+}
+
+func TestWrapUnary_RedactsHeaders(t *testing.T) {
+	t.Parallel()
+	var buf bytes.Buffer
+	interceptor := New(newTestLogger(&buf), WithAllowedHeaders("Authorization"))
+	req := &fakeUnaryConn{
+		peer:   connect.Peer{Addr: "127.0.0.1:1234", Protocol: connect.ProtocolConnect},
+		header: http.Header{"Authorization": []string{"Bearer secret"}},
+		msg:    &wrapperspb.StringValue{Value: "hi"},
+	}
+	_, err := interceptor.WrapUnary(func(_ context.Context, _ connect.AnyRequest) (connect.AnyResponse, error) {
+		return connect.NewResponse(&wrapperspb.StringValue{Value: "ok"}), nil
+	})(context.Background(), req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, line := range logLines(t, &buf) {
+		if line["header.authorization"] == "Bearer secret" {
+			t.Fatalf("Authorization header was logged in the clear: %v", line)
+		}
+	}
+}
+
+func TestWrapUnary_PayloadLogging(t *testing.T) {
+	t.Parallel()
+	var buf bytes.Buffer
+	interceptor := New(newTestLogger(&buf), WithPayloadLogging(8))
+	req := &fakeUnaryConn{
+		peer:   connect.Peer{},
+		header: http.Header{},
+		msg:    &wrapperspb.StringValue{Value: "hi"},
+	}
+	_, err := interceptor.WrapUnary(func(_ context.Context, _ connect.AnyRequest) (connect.AnyResponse, error) {
+		return connect.NewResponse(&wrapperspb.StringValue{Value: "a very long response value"}), nil
+	})(context.Background(), req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	lines := logLines(t, &buf)
+	started, finished := lines[0], lines[1]
+	if want := `"hi"`; started["request_payload"] != want {
+		t.Errorf("request_payload = %v, want %q", started["request_payload"], want)
+	}
+	got, ok := finished["response_payload"].(string)
+	if !ok || len(got) != 8+len("...") || !strings.HasSuffix(got, "...") {
+		t.Fatalf("response_payload = %v, want 8 bytes truncated with an ellipsis", finished["response_payload"])
+	}
+}
+
+func TestWrapUnary_Sampler(t *testing.T) {
+	t.Parallel()
+	var buf bytes.Buffer
+	interceptor := New(newTestLogger(&buf), WithSampler(func(connect.Spec) bool { return false }))
+	req := &fakeUnaryConn{peer: connect.Peer{}, header: http.Header{}, msg: &wrapperspb.StringValue{}}
+	called := false
+	_, err := interceptor.WrapUnary(func(_ context.Context, _ connect.AnyRequest) (connect.AnyResponse, error) {
+		called = true
+		return connect.NewResponse(&wrapperspb.StringValue{}), nil
+	})(context.Background(), req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !called {
+		t.Fatal("handler was not called")
+	}
+	if buf.Len() != 0 {
+		t.Fatalf("expected no log output when sampled out, got %q", buf.String())
+	}
+}
+
+// fakeStreamingHandlerConn is a minimal connect.StreamingHandlerConn good
+// enough to drive WrapStreamingHandler in tests. The interceptor treats
+// every stream shape identically (it just counts Send/Receive calls), so
+// the same fake backs the server-stream, client-stream, and bidi cases.
+type fakeStreamingHandlerConn struct {
+	streamType connect.StreamType
+	peer       connect.Peer
+	header     http.Header
+	received   []any
+	toSend     []any
+}
+
+func (f *fakeStreamingHandlerConn) Spec() connect.Spec           { return newTestSpec(f.streamType) }
+func (f *fakeStreamingHandlerConn) Peer() connect.Peer           { return f.peer }
+func (f *fakeStreamingHandlerConn) RequestHeader() http.Header   { return f.header }
+func (f *fakeStreamingHandlerConn) ResponseHeader() http.Header  { return http.Header{} }
+func (f *fakeStreamingHandlerConn) ResponseTrailer() http.Header { return http.Header{} }
+
+func (f *fakeStreamingHandlerConn) Receive(msg any) error {
+	if len(f.received) == 0 {
+		return io.EOF
+	}
+	next := f.received[0]
+	f.received = f.received[1:]
+	if sv, ok := msg.(*wrapperspb.StringValue); ok {
+		sv.Value = next.(*wrapperspb.StringValue).Value
+	}
+	return nil
+}
+
+func (f *fakeStreamingHandlerConn) Send(msg any) error {
+	f.toSend = append(f.toSend, msg)
+	return nil
+}
+
+// fakeStreamingClientConn is a minimal connect.StreamingClientConn good
+// enough to drive WrapStreamingClient in tests.
+type fakeStreamingClientConn struct {
+	streamType connect.StreamType
+	peer       connect.Peer
+	received   []any
+	sent       []any
+	closeErr   error
+}
+
+func (f *fakeStreamingClientConn) Spec() connect.Spec           { return newTestSpec(f.streamType) }
+func (f *fakeStreamingClientConn) Peer() connect.Peer           { return f.peer }
+func (f *fakeStreamingClientConn) RequestHeader() http.Header   { return http.Header{} }
+func (f *fakeStreamingClientConn) ResponseHeader() http.Header  { return http.Header{} }
+func (f *fakeStreamingClientConn) ResponseTrailer() http.Header { return http.Header{} }
+func (f *fakeStreamingClientConn) CloseRequest() error          { return nil }
+
+func (f *fakeStreamingClientConn) Send(msg any) error {
+	f.sent = append(f.sent, msg)
+	return nil
+}
+
+func (f *fakeStreamingClientConn) Receive(msg any) error {
+	if len(f.received) == 0 {
+		return io.EOF
+	}
+	next := f.received[0]
+	f.received = f.received[1:]
+	if sv, ok := msg.(*wrapperspb.StringValue); ok {
+		sv.Value = next.(*wrapperspb.StringValue).Value
+	}
+	return nil
+}
+
+func (f *fakeStreamingClientConn) CloseResponse() error { return f.closeErr }
+
+func TestWrapStreamingClient_CountsMessagesAndLogsOnce(t *testing.T) {
+	t.Parallel()
+	var buf bytes.Buffer
+	interceptor := New(newTestLogger(&buf))
+
+	fake := &fakeStreamingClientConn{
+		streamType: connect.StreamTypeBidi,
+		peer:       connect.Peer{Addr: "127.0.0.1:1234", Protocol: connect.ProtocolGRPC},
+		received: []any{
+			&wrapperspb.StringValue{Value: "one"},
+			&wrapperspb.StringValue{Value: "two"},
+		},
+	}
+	conn := interceptor.WrapStreamingClient(func(context.Context, connect.Spec) connect.StreamingClientConn {
+		return fake
+	})(context.Background(), newTestSpec(connect.StreamTypeBidi))
+
+	if err := conn.Send(&wrapperspb.StringValue{Value: "hi"}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	var msg wrapperspb.StringValue
+	for {
+		if err := conn.Receive(&msg); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			t.Fatalf("Receive: %v", err)
+		}
+	}
+	if err := conn.CloseResponse(); err != nil {
+		t.Fatalf("CloseResponse: %v", err)
+	}
+	// CloseResponse can be called more than once by generated client code;
+	// logEnd's dedup guard must make sure that only logs stream_finished once.
+	if err := conn.CloseResponse(); err != nil {
+		t.Fatalf("second CloseResponse: %v", err)
+	}
+
+	lines := logLines(t, &buf)
+	var finishedCount int
+	var finished map[string]any
+	for _, line := range lines {
+		if line["msg"] == "stream_finished" {
+			finishedCount++
+			finished = line
+		}
+	}
+	if finishedCount != 1 {
+		t.Fatalf("got %d stream_finished lines, want 1", finishedCount)
+	}
+	if finished["messages_sent"].(float64) != 1 {
+		t.Errorf("messages_sent = %v, want 1", finished["messages_sent"])
+	}
+	if finished["messages_received"].(float64) != 2 {
+		t.Errorf("messages_received = %v, want 2", finished["messages_received"])
+	}
+	if finished["level"] != "INFO" {
+		t.Errorf("level = %v, want INFO", finished["level"])
+	}
+}
+
+func TestWrapStreamingClient_LogsErrorOnCloseResponse(t *testing.T) {
+	t.Parallel()
+	var buf bytes.Buffer
+	interceptor := New(newTestLogger(&buf))
+
+	wantErr := connect.NewError(connect.CodeUnavailable, errors.New("down"))
+	fake := &fakeStreamingClientConn{streamType: connect.StreamTypeServer, closeErr: wantErr}
+	conn := interceptor.WrapStreamingClient(func(context.Context, connect.Spec) connect.StreamingClientConn {
+		return fake
+	})(context.Background(), newTestSpec(connect.StreamTypeServer))
+
+	err := conn.CloseResponse()
+	if !errors.Is(err, wantErr) {
+		t.Fatalf("CloseResponse = %v, want %v", err, wantErr)
+	}
+
+	lines := logLines(t, &buf)
+	finished := lines[len(lines)-1]
+	if finished["msg"] != "stream_finished" || finished["level"] != "ERROR" {
+		t.Fatalf("finished line = %v, want stream_finished at ERROR", finished)
+	}
+}
+
+func TestWrapStreamingHandler_CountsMessages(t *testing.T) {
+	t.Parallel()
+	streamTypes := map[string]connect.StreamType{
+		"server-stream": connect.StreamTypeServer,
+		"client-stream": connect.StreamTypeClient,
+		"bidi-stream":   connect.StreamTypeBidi,
+	}
+	for name, streamType := range streamTypes {
+		name, streamType := name, streamType
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			var buf bytes.Buffer
+			interceptor := New(newTestLogger(&buf))
+
+			conn := &fakeStreamingHandlerConn{
+				streamType: streamType,
+				peer:       connect.Peer{Addr: "127.0.0.1:1234", Protocol: connect.ProtocolGRPC},
+				header:     http.Header{},
+				received: []any{
+					&wrapperspb.StringValue{Value: "one"},
+					&wrapperspb.StringValue{Value: "two"},
+				},
+			}
+
+			handler := interceptor.WrapStreamingHandler(func(_ context.Context, conn connect.StreamingHandlerConn) error {
+				for {
+					var msg wrapperspb.StringValue
+					if err := conn.Receive(&msg); err != nil {
+						if errors.Is(err, io.EOF) {
+							return nil
+						}
+						return err
+					}
+					if err := conn.Send(&msg); err != nil {
+						return err
+					}
+				}
+			})
+			if err := handler(context.Background(), conn); err != nil {
+				t.Fatalf("handler: %v", err)
+			}
+
+			lines := logLines(t, &buf)
+			finished := lines[len(lines)-1]
+			if finished["messages_received"].(float64) != 2 {
+				t.Errorf("messages_received = %v, want 2", finished["messages_received"])
+			}
+			if finished["messages_sent"].(float64) != 2 {
+				t.Errorf("messages_sent = %v, want 2", finished["messages_sent"])
+			}
+		})
+	}
+}
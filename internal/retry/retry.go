@@ -0,0 +1,260 @@
+// Copyright 2022-2023 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package retry provides a connect.HTTPClient that automatically retries
+// transient failures using the same connection-backoff algorithm gRPC uses
+// for reconnects: a base delay that grows by a constant factor on every
+// attempt, capped at a maximum delay, with uniform jitter applied so that
+// many clients don't retry in lockstep.
+//
+// Only unary RPCs invoked over HTTP GET are retried, since a side-effect-free
+// unary call marked with connect.IdempotencyNoSideEffects is the only kind of
+// request the Connect protocol will send as a GET (see
+// connect.WithHTTPGet). Streaming calls, and any unary call sent as a POST,
+// are passed through untouched because their request bodies can't be safely
+// replayed.
+package retry
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultBaseDelay  = time.Second
+	defaultFactor     = 1.6
+	defaultMaxDelay   = 120 * time.Second
+	defaultJitter     = 0.2
+	defaultMaxRetries = 5
+
+	// codeUnavailable is the wire representation of connect.CodeUnavailable,
+	// duplicated here so this package doesn't need to import connect just to
+	// compare error codes found in Connect unary error bodies. Response
+	// trailers are not inspected.
+	codeUnavailable = "unavailable"
+)
+
+// Option configures a Client constructed with NewClient.
+type Option func(*Client)
+
+// WithBaseDelay sets the delay used for the first retry. Subsequent retries
+// grow by Factor until MaxDelay is reached. The default is one second.
+func WithBaseDelay(d time.Duration) Option {
+	return func(c *Client) { c.baseDelay = d }
+}
+
+// WithFactor sets the multiplier applied to the delay after each attempt.
+// The default, 1.6, matches gRPC's connection-backoff default.
+func WithFactor(factor float64) Option {
+	return func(c *Client) { c.factor = factor }
+}
+
+// WithMaxDelay caps the computed delay between retries, before jitter is
+// applied. The default is 120 seconds.
+func WithMaxDelay(d time.Duration) Option {
+	return func(c *Client) { c.maxDelay = d }
+}
+
+// WithJitter sets the uniform jitter fraction applied to each computed
+// delay: the actual delay is chosen uniformly from
+// [delay*(1-jitter), delay*(1+jitter)]. The default is 0.2.
+func WithJitter(jitter float64) Option {
+	return func(c *Client) { c.jitter = jitter }
+}
+
+// WithMaxRetries bounds the number of retries attempted for a single request,
+// independent of ctx.Done(). The default is 5.
+func WithMaxRetries(n int) Option {
+	return func(c *Client) { c.maxRetries = n }
+}
+
+// Client wraps a connect.HTTPClient and retries transient failures on
+// idempotent, side-effect-free unary calls. The zero value is not usable;
+// construct one with NewClient.
+type Client struct {
+	transport HTTPClient
+
+	baseDelay  time.Duration
+	factor     float64
+	maxDelay   time.Duration
+	jitter     float64
+	maxRetries int
+
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+// HTTPClient is the subset of *http.Client that connect.HTTPClient requires.
+// It's redeclared here so this package doesn't need to import connect-go
+// just for a one-method interface.
+type HTTPClient interface {
+	Do(*http.Request) (*http.Response, error)
+}
+
+var _ HTTPClient = (*Client)(nil)
+
+// NewClient wraps transport with retry/backoff behavior and returns a value
+// suitable for passing as the connect.HTTPClient argument of a generated
+// client constructor.
+func NewClient(transport HTTPClient, opts ...Option) *Client {
+	c := &Client{
+		transport:  transport,
+		baseDelay:  defaultBaseDelay,
+		factor:     defaultFactor,
+		maxDelay:   defaultMaxDelay,
+		jitter:     defaultJitter,
+		maxRetries: defaultMaxRetries,
+		rand:       rand.New(rand.NewSource(time.Now().UnixNano())), //nolint:gosec
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Do implements HTTPClient. Requests that aren't side-effect-free unary
+// calls (that is, anything other than an HTTP GET) are forwarded to the
+// underlying transport without modification.
+func (c *Client) Do(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet {
+		return c.transport.Do(req)
+	}
+	ctx := req.Context()
+	delay := c.baseDelay
+	var lastErr error
+	for attempt := 0; ; attempt++ {
+		res, err := c.transport.Do(req.Clone(ctx))
+		retry, wait, hasWait := c.shouldRetry(res, err)
+		if !retry {
+			return res, err
+		}
+		lastErr = err
+		if attempt >= c.maxRetries {
+			if res != nil {
+				return res, nil
+			}
+			return nil, lastErr
+		}
+		if res != nil {
+			io.Copy(io.Discard, res.Body) //nolint:errcheck
+			res.Body.Close()              //nolint:errcheck
+		}
+		if !hasWait {
+			wait = c.jittered(delay)
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
+		delay = nextDelay(delay, c.factor, c.maxDelay)
+	}
+}
+
+// shouldRetry inspects the outcome of one attempt and reports whether it's
+// worth retrying. When the response carries a Retry-After header, hasRetryAfter
+// is true and retryAfter is returned as the wait duration, overriding the
+// computed backoff even when the header's value is zero.
+func (c *Client) shouldRetry(res *http.Response, err error) (retry bool, retryAfter time.Duration, hasRetryAfter bool) {
+	if err != nil {
+		return true, 0, false
+	}
+	if res.StatusCode == http.StatusServiceUnavailable {
+		retryAfter, hasRetryAfter = parseRetryAfter(res.Header.Get("Retry-After"))
+		return true, retryAfter, hasRetryAfter
+	}
+	if code, ok := readErrorCode(res); ok && code == codeUnavailable {
+		retryAfter, hasRetryAfter = parseRetryAfter(res.Header.Get("Retry-After"))
+		return true, retryAfter, hasRetryAfter
+	}
+	return false, 0, false
+}
+
+// jittered applies uniform jitter to delay, producing a value in
+// [delay*(1-jitter), delay*(1+jitter)].
+func (c *Client) jittered(delay time.Duration) time.Duration {
+	if c.jitter <= 0 {
+		return delay
+	}
+	c.mu.Lock()
+	spread := c.jitter * (2*c.rand.Float64() - 1)
+	c.mu.Unlock()
+	return time.Duration(float64(delay) * (1 + spread))
+}
+
+// nextDelay grows delay by factor, capped at maxDelay.
+func nextDelay(delay time.Duration, factor float64, maxDelay time.Duration) time.Duration {
+	delay = time.Duration(float64(delay) * factor)
+	if delay > maxDelay {
+		delay = maxDelay
+	}
+	return delay
+}
+
+// parseRetryAfter parses the value of a Retry-After header, which per RFC
+// 9110 is either a number of seconds or an HTTP-date. ok is false if the
+// header is absent or malformed, distinguishing that case from a header
+// that's explicitly present with a zero value.
+func parseRetryAfter(value string) (d time.Duration, ok bool) {
+	if value == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(value); err == nil {
+		if secs < 0 {
+			return 0, false
+		}
+		return time.Duration(secs) * time.Second, true
+	}
+	if when, err := http.ParseTime(value); err == nil {
+		return time.Until(when), true
+	}
+	return 0, false
+}
+
+// errorBody is the subset of the Connect unary error envelope we care
+// about: https://connectrpc.com/docs/protocol#unary-error.
+type errorBody struct {
+	Code string `json:"code"`
+}
+
+// readErrorCode reads res.Body looking for a Connect-protocol error code,
+// then restores the body so the caller can still read it when a retry isn't
+// warranted. It reports ok=false if the body isn't a recognizable Connect
+// error envelope.
+func readErrorCode(res *http.Response) (code string, ok bool) {
+	if res.StatusCode == http.StatusOK || res.Body == nil {
+		return "", false
+	}
+	if !strings.Contains(res.Header.Get("Content-Type"), "json") {
+		return "", false
+	}
+	data, err := io.ReadAll(res.Body)
+	res.Body.Close() //nolint:errcheck
+	res.Body = io.NopCloser(bytes.NewReader(data))
+	if err != nil {
+		return "", false
+	}
+	var body errorBody
+	if err := json.Unmarshal(data, &body); err != nil {
+		return "", false
+	}
+	return body.Code, body.Code != ""
+}
@@ -0,0 +1,249 @@
+// Copyright 2022-2023 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package retry
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"connectrpc.com/connect"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+var errUnavailable = errors.New("unavailable")
+
+// flakyHandler fails the first failBefore requests it receives, counted
+// across all paths, then succeeds, mimicking a Connect unary handler that's
+// recovering from a transient outage.
+func flakyHandler(t *testing.T, failBefore int32) (http.Handler, *int32) {
+	t.Helper()
+	var attempts int32
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&attempts, 1)
+		if n <= failBefore {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = w.Write([]byte(`{"code":"unavailable","message":"try again"}`))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(`{"sentence":"ok"}`))
+	}), &attempts
+}
+
+func newGetRequest(t *testing.T, ctx context.Context, url string) *http.Request {
+	t.Helper()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatalf("build request: %v", err)
+	}
+	return req
+}
+
+func TestClient_RetriesUntilSuccess(t *testing.T) {
+	t.Parallel()
+	handler, attempts := flakyHandler(t, 2)
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	client := NewClient(http.DefaultClient, WithBaseDelay(time.Millisecond), WithMaxDelay(10*time.Millisecond))
+	res, err := client.Do(newGetRequest(t, context.Background(), srv.URL))
+	if err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want 200", res.StatusCode)
+	}
+	if got := atomic.LoadInt32(attempts); got != 3 {
+		t.Fatalf("attempts = %d, want 3", got)
+	}
+}
+
+func TestClient_GivesUpAfterMaxRetries(t *testing.T) {
+	t.Parallel()
+	handler, attempts := flakyHandler(t, 100)
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	client := NewClient(
+		http.DefaultClient,
+		WithBaseDelay(time.Millisecond),
+		WithMaxDelay(10*time.Millisecond),
+		WithMaxRetries(2),
+	)
+	res, err := client.Do(newGetRequest(t, context.Background(), srv.URL))
+	if err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want 503", res.StatusCode)
+	}
+	if got := atomic.LoadInt32(attempts); got != 3 {
+		t.Fatalf("attempts = %d, want 3 (1 initial + 2 retries)", got)
+	}
+}
+
+func TestClient_HonorsRetryAfter(t *testing.T) {
+	t.Parallel()
+	var attempts int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(srv.Close)
+
+	// A large base delay would make this test slow unless Retry-After, which
+	// is 0 here, overrides the computed backoff.
+	client := NewClient(http.DefaultClient, WithBaseDelay(time.Minute))
+	start := time.Now()
+	res, err := client.Do(newGetRequest(t, context.Background(), srv.URL))
+	if err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+	defer res.Body.Close()
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("took %s, Retry-After should have bypassed the base delay", elapsed)
+	}
+}
+
+func TestClient_LeavesNonGETRequestsAlone(t *testing.T) {
+	t.Parallel()
+	handler, attempts := flakyHandler(t, 2)
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	client := NewClient(http.DefaultClient, WithBaseDelay(time.Millisecond))
+	req, err := http.NewRequest(http.MethodPost, srv.URL, nil)
+	if err != nil {
+		t.Fatalf("build request: %v", err)
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want 503 (unary POST retries are unsupported)", res.StatusCode)
+	}
+	if got := atomic.LoadInt32(attempts); got != 1 {
+		t.Fatalf("attempts = %d, want 1", got)
+	}
+}
+
+func TestClient_AbortsOnContextCancel(t *testing.T) {
+	t.Parallel()
+	handler, _ := flakyHandler(t, 100)
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	client := NewClient(http.DefaultClient, WithBaseDelay(time.Hour))
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := client.Do(newGetRequest(t, ctx, srv.URL))
+	if err == nil {
+		t.Fatal("expected an error from context cancellation")
+	}
+}
+
+// TestClient_ThroughConnectClient drives retry.Client the way main.go
+// actually wires it: as the HTTPClient behind a connect.Client, proving the
+// wiring retries an IdempotencyNoSideEffects-marked RPC (like Say) sent over
+// GET, while leaving a non-idempotent RPC (like Introduce or Converse) that
+// stays on POST untouched.
+func TestClient_ThroughConnectClient(t *testing.T) {
+	t.Parallel()
+	const idempotentProcedure = "/test.Service/Idempotent"
+	const sideEffectingProcedure = "/test.Service/SideEffecting"
+
+	var idempotentAttempts, sideEffectingAttempts int32
+	mux := http.NewServeMux()
+	mux.Handle(idempotentProcedure, connect.NewUnaryHandler(
+		idempotentProcedure,
+		func(_ context.Context, req *connect.Request[wrapperspb.StringValue]) (*connect.Response[wrapperspb.StringValue], error) {
+			if atomic.AddInt32(&idempotentAttempts, 1) <= 2 {
+				return nil, connect.NewError(connect.CodeUnavailable, errUnavailable)
+			}
+			return connect.NewResponse(&wrapperspb.StringValue{Value: "ok"}), nil
+		},
+		connect.WithIdempotency(connect.IdempotencyNoSideEffects),
+	))
+	mux.Handle(sideEffectingProcedure, connect.NewUnaryHandler(
+		sideEffectingProcedure,
+		func(_ context.Context, req *connect.Request[wrapperspb.StringValue]) (*connect.Response[wrapperspb.StringValue], error) {
+			atomic.AddInt32(&sideEffectingAttempts, 1)
+			return nil, connect.NewError(connect.CodeUnavailable, errUnavailable)
+		},
+	))
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	httpClient := NewClient(http.DefaultClient, WithBaseDelay(time.Millisecond), WithMaxDelay(10*time.Millisecond))
+	idempotentClient := connect.NewClient[wrapperspb.StringValue, wrapperspb.StringValue](
+		httpClient, srv.URL+idempotentProcedure,
+		connect.WithIdempotency(connect.IdempotencyNoSideEffects), connect.WithHTTPGet(),
+	)
+	sideEffectingClient := connect.NewClient[wrapperspb.StringValue, wrapperspb.StringValue](
+		httpClient, srv.URL+sideEffectingProcedure,
+		connect.WithHTTPGet(), // has no effect: the procedure isn't marked idempotent, so it stays on POST.
+	)
+
+	res, err := idempotentClient.CallUnary(context.Background(), connect.NewRequest(&wrapperspb.StringValue{Value: "hi"}))
+	if err != nil {
+		t.Fatalf("idempotent call: %v", err)
+	}
+	if res.Msg.Value != "ok" {
+		t.Fatalf("idempotent call response = %q, want %q", res.Msg.Value, "ok")
+	}
+	if got := atomic.LoadInt32(&idempotentAttempts); got != 3 {
+		t.Fatalf("idempotent attempts = %d, want 3 (retried through the GET path)", got)
+	}
+
+	_, err = sideEffectingClient.CallUnary(context.Background(), connect.NewRequest(&wrapperspb.StringValue{Value: "hi"}))
+	if err == nil {
+		t.Fatal("expected the side-effecting call to fail")
+	}
+	if got := atomic.LoadInt32(&sideEffectingAttempts); got != 1 {
+		t.Fatalf("side-effecting attempts = %d, want 1 (POST requests aren't retried)", got)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	t.Parallel()
+	if got, ok := parseRetryAfter(""); ok || got != 0 {
+		t.Fatalf("empty header: got (%s, %v), want (0, false)", got, ok)
+	}
+	if got, ok := parseRetryAfter(strconv.Itoa(5)); !ok || got != 5*time.Second {
+		t.Fatalf("numeric header: got (%s, %v), want (5s, true)", got, ok)
+	}
+	if got, ok := parseRetryAfter("0"); !ok || got != 0 {
+		t.Fatalf("explicit zero header: got (%s, %v), want (0, true)", got, ok)
+	}
+	if got, ok := parseRetryAfter("not-a-valid-value"); ok || got != 0 {
+		t.Fatalf("malformed header: got (%s, %v), want (0, false)", got, ok)
+	}
+}
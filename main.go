@@ -7,6 +7,7 @@ import (
 
 	elizav1 "connect-examples-go/internal/gen/connectrpc/eliza/v1"
 	"connect-examples-go/internal/gen/connectrpc/eliza/v1/elizav1connect"
+	"connect-examples-go/internal/retry"
 
 	"connectrpc.com/connect"
 )
@@ -14,10 +15,9 @@ import (
 func main() {
 	log.SetFlags(0)
 	client := elizav1connect.NewElizaServiceClient(
-		&http.Client{
-			Transport: &transport{},
-		},
+		retry.NewClient(&http.Client{Transport: &http.Transport{}}),
 		"http://localhost:8082",
+		connect.WithHTTPGet(),
 	)
 	res, err := client.Say(
 		context.Background(),
@@ -37,9 +37,3 @@ func main() {
 	}
 	_ = sres.Close()
 }
-
-type transport struct{}
-
-func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
-	return (&http.Transport{}).RoundTrip(req)
-}